@@ -0,0 +1,64 @@
+package handler
+
+import (
+	"io"
+	"net"
+)
+
+// OutboundHandler splices bytes between the client connection and
+// the previously dialed outbound connection.
+type OutboundHandler struct {
+}
+
+// HandleRequest copies data in both directions between the client
+// and outbound connections until both sides have closed or errored
+// out.
+func (handler *OutboundHandler) HandleRequest(request *Request) error {
+	request.SetState(CONNECTED)
+
+	errCh := make(chan error, 2)
+
+	go func() {
+		n, err := io.Copy(request.OutboundConnection(), request.Conn())
+		request.AddBytesUp(n)
+		if err == nil {
+			closeWrite(request.OutboundConnection())
+		}
+		errCh <- err
+	}()
+
+	go func() {
+		n, err := io.Copy(request.Conn(), request.OutboundConnection())
+		request.AddBytesDown(n)
+		if err == nil {
+			closeWrite(request.Conn())
+		}
+		errCh <- err
+	}()
+
+	// Wait for both directions, not just whichever finishes first --
+	// an asymmetric tunnel where the client stops writing early but
+	// is still awaiting a large response must not be torn down the
+	// moment the first direction returns, and BytesUp/BytesDown must
+	// both be committed before the caller reads them.
+	for i := 0; i < 2; i++ {
+		if err := <-errCh; err != nil && err != io.EOF {
+			request.Logger().Error("error while splicing connection", "error", err)
+		}
+	}
+
+	return nil
+}
+
+// closeWrite half-closes conn's write side, if it supports it, so
+// the peer observes EOF instead of the relay appearing to hang. This
+// matters for request/response protocols where one side signals
+// "done sending" by half-closing rather than by closing the whole
+// connection -- without forwarding that signal, the other side's
+// io.Copy never sees EOF and the session blocks until the idle
+// timeout fires, or forever if it doesn't.
+func closeWrite(conn net.Conn) {
+	if tc, ok := conn.(interface{ CloseWrite() error }); ok {
+		tc.CloseWrite()
+	}
+}
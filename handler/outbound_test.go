@@ -0,0 +1,143 @@
+package handler
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// TestOutboundHandlerWaitsForBothDirections exercises the asymmetric
+// tunnel case this package exists to support: the client finishes
+// writing its request and goes quiet, but the destination is still
+// streaming its response. HandleRequest must not return -- and tear
+// the connection down -- the moment the client-to-destination copy
+// sees EOF; it must wait for the destination-to-client copy too.
+func TestOutboundHandlerWaitsForBothDirections(t *testing.T) {
+	clientSide, clientPeer := net.Pipe()
+	outboundSide, outboundPeer := net.Pipe()
+
+	request := NewRequest(clientSide, nil)
+	request.SetOutboundConnection(outboundSide)
+
+	go func() {
+		clientPeer.Write([]byte("request"))
+	}()
+
+	go func() {
+		upstream := make([]byte, len("request"))
+		io.ReadFull(outboundPeer, upstream)
+		// The destination is slow to respond; the relay must still
+		// wait for it instead of closing early.
+		time.Sleep(50 * time.Millisecond)
+		outboundPeer.Write([]byte("response"))
+		outboundPeer.Close()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		(&OutboundHandler{}).HandleRequest(request)
+		close(done)
+	}()
+
+	downstream := make([]byte, len("response"))
+	if _, err := io.ReadFull(clientPeer, downstream); err != nil {
+		t.Fatalf("failed to read relayed response: %v", err)
+	}
+	if string(downstream) != "response" {
+		t.Fatalf("got %q, want %q", downstream, "response")
+	}
+
+	clientPeer.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("HandleRequest did not return after both directions finished")
+	}
+
+	if request.BytesUp() == 0 || request.BytesDown() == 0 {
+		t.Errorf("expected both directions to report bytes, got up=%d down=%d", request.BytesUp(), request.BytesDown())
+	}
+}
+
+// tcpPipe returns a connected pair of real TCP connections, since
+// net.Pipe's in-memory conns don't implement CloseWrite and this
+// test needs to exercise half-close forwarding.
+func tcpPipe(t *testing.T) (net.Conn, net.Conn) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	acceptedCh := make(chan net.Conn, 1)
+	go func() {
+		accepted, _ := listener.Accept()
+		acceptedCh <- accepted
+	}()
+
+	dialed, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	accepted := <-acceptedCh
+	if accepted == nil {
+		t.Fatalf("failed to accept")
+	}
+	return dialed, accepted
+}
+
+// TestOutboundHandlerForwardsHalfCloseToDestination covers a plain
+// request/response protocol where the client signals "done sending"
+// by half-closing its write side (e.g. a simple line protocol, or
+// some HTTP/1.0 clients) rather than closing the whole connection.
+// The destination only replies once it observes EOF; if the relay
+// doesn't forward the half-close as a real CloseWrite, the
+// destination never sees EOF and the session hangs.
+func TestOutboundHandlerForwardsHalfCloseToDestination(t *testing.T) {
+	clientSide, clientPeer := tcpPipe(t)
+	defer clientPeer.Close()
+	outboundSide, outboundPeer := tcpPipe(t)
+	defer outboundPeer.Close()
+
+	request := NewRequest(clientSide, nil)
+	request.SetOutboundConnection(outboundSide)
+
+	go func() {
+		clientPeer.Write([]byte("request"))
+		clientPeer.(interface{ CloseWrite() error }).CloseWrite()
+	}()
+
+	go func() {
+		upstream, err := io.ReadAll(outboundPeer)
+		if err != nil || string(upstream) != "request" {
+			return
+		}
+		outboundPeer.Write([]byte("response"))
+		outboundPeer.Close()
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		(&OutboundHandler{}).HandleRequest(request)
+		close(done)
+	}()
+
+	clientPeer.SetReadDeadline(time.Now().Add(2 * time.Second))
+	downstream, err := io.ReadAll(clientPeer)
+	if err != nil {
+		t.Fatalf("failed to read relayed response: %v", err)
+	}
+	if string(downstream) != "response" {
+		t.Fatalf("got %q, want %q -- destination likely never saw EOF", downstream, "response")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("HandleRequest did not return")
+	}
+}
@@ -0,0 +1,209 @@
+package handler
+
+import (
+	"fmt"
+	"hiteshkotian/ssl-tunnel/logging"
+	"net"
+	"sync/atomic"
+	"time"
+)
+
+// connIDSeq generates the correlation ID attached to every Request,
+// so a single connection's log lines can be grepped out of an
+// aggregated stream.
+var connIDSeq int64
+
+// Request wraps the client connection and tracks the state
+// associated with a single SOCKS5 session.
+type Request struct {
+	conn  net.Conn
+	state State
+
+	connID string
+	logger logging.Logger
+
+	outboundConn net.Conn
+	outboundIP   string
+	outboundPort uint16
+	atype        uint8
+
+	// udpRelay is set for sessions established via UDP ASSOCIATE.
+	// It is torn down when the request is closed, since the TCP
+	// control connection owns the lifetime of the relay.
+	udpRelay *net.UDPConn
+
+	// identity is the name the client authenticated as, set by
+	// whichever Authenticator handled the method negotiation.
+	identity string
+
+	startedAt time.Time
+	bytesUp   int64
+	bytesDown int64
+}
+
+// NewRequest creates a new Request around the given client
+// connection, assigning it a correlation ID and a logger derived
+// from base (logging.Default() if nil) bound to that ID and the
+// client's address.
+func NewRequest(conn net.Conn, base logging.Logger) *Request {
+	connID := fmt.Sprintf("c%d", atomic.AddInt64(&connIDSeq, 1))
+	if base == nil {
+		base = logging.Default()
+	}
+
+	return &Request{
+		conn:      conn,
+		state:     NEW,
+		startedAt: time.Now(),
+		connID:    connID,
+		logger:    base.With("conn_id", connID, "client_addr", conn.RemoteAddr().String()),
+	}
+}
+
+// Read reads from the underlying client connection.
+func (request *Request) Read(data []byte) (int, error) {
+	return request.conn.Read(data)
+}
+
+// Write writes to the underlying client connection.
+func (request *Request) Write(data []byte) (int, error) {
+	return request.conn.Write(data)
+}
+
+// Close closes the client connection along with any outbound
+// connection or UDP relay associated with it.
+func (request *Request) Close() error {
+	if request.udpRelay != nil {
+		request.udpRelay.Close()
+	}
+	if request.outboundConn != nil {
+		request.outboundConn.Close()
+	}
+	return request.conn.Close()
+}
+
+// Conn returns the underlying client connection.
+func (request *Request) Conn() net.Conn {
+	return request.conn
+}
+
+// SetConn replaces the underlying client connection, e.g. to swap
+// in a connection wrapper once the handshake phase has completed.
+func (request *Request) SetConn(conn net.Conn) {
+	request.conn = conn
+}
+
+// Elapsed returns how long ago this Request was created.
+func (request *Request) Elapsed() time.Duration {
+	return time.Since(request.startedAt)
+}
+
+// AddBytesUp adds to the running total of bytes relayed from the
+// client to the destination.
+func (request *Request) AddBytesUp(n int64) {
+	atomic.AddInt64(&request.bytesUp, n)
+}
+
+// AddBytesDown adds to the running total of bytes relayed from the
+// destination to the client.
+func (request *Request) AddBytesDown(n int64) {
+	atomic.AddInt64(&request.bytesDown, n)
+}
+
+// BytesUp returns the running total of bytes relayed from the
+// client to the destination.
+func (request *Request) BytesUp() int64 {
+	return atomic.LoadInt64(&request.bytesUp)
+}
+
+// BytesDown returns the running total of bytes relayed from the
+// destination to the client.
+func (request *Request) BytesDown() int64 {
+	return atomic.LoadInt64(&request.bytesDown)
+}
+
+// State returns the current state of the request.
+func (request *Request) State() State {
+	return request.state
+}
+
+// SetState updates the current state of the request.
+func (request *Request) SetState(state State) {
+	request.state = state
+}
+
+// SetOutboundConnection records the dialed destination connection.
+func (request *Request) SetOutboundConnection(conn net.Conn) {
+	request.outboundConn = conn
+}
+
+// OutboundConnection returns the dialed destination connection.
+func (request *Request) OutboundConnection() net.Conn {
+	return request.outboundConn
+}
+
+// SetOutboundIP records the resolved destination IP address.
+func (request *Request) SetOutboundIP(ip string) {
+	request.outboundIP = ip
+}
+
+// OutboundIP returns the resolved destination IP address.
+func (request *Request) OutboundIP() string {
+	return request.outboundIP
+}
+
+// SetOutboundPort records the destination port.
+func (request *Request) SetOutboundPort(port uint16) {
+	request.outboundPort = port
+}
+
+// OutboundPort returns the destination port.
+func (request *Request) OutboundPort() uint16 {
+	return request.outboundPort
+}
+
+// SetAtype records the SOCKS5 address type (ATYP) of the request.
+func (request *Request) SetAtype(atype uint8) {
+	request.atype = atype
+}
+
+// Atype returns the SOCKS5 address type (ATYP) of the request.
+func (request *Request) Atype() uint8 {
+	return request.atype
+}
+
+// ConnID returns this Request's correlation ID.
+func (request *Request) ConnID() string {
+	return request.connID
+}
+
+// Logger returns the Logger bound to this Request's correlation ID
+// and client address. Use SetLogger to enrich it further (e.g. once
+// the destination is known).
+func (request *Request) Logger() logging.Logger {
+	return request.logger
+}
+
+// SetLogger replaces the Logger bound to this Request, typically
+// with one further bound to additional fields via Logger().With(...).
+func (request *Request) SetLogger(logger logging.Logger) {
+	request.logger = logger
+}
+
+// SetIdentity records the name the client authenticated as.
+func (request *Request) SetIdentity(identity string) {
+	request.identity = identity
+}
+
+// Identity returns the name the client authenticated as, or an
+// empty string if the negotiated method does not establish one.
+func (request *Request) Identity() string {
+	return request.identity
+}
+
+// SetUDPRelay records the UDP relay socket opened for a UDP
+// ASSOCIATE session so that it can be torn down when the
+// controlling TCP connection is closed.
+func (request *Request) SetUDPRelay(relay *net.UDPConn) {
+	request.udpRelay = relay
+}
@@ -0,0 +1,20 @@
+package handler
+
+// State represents the stage a client connection has reached as it
+// progresses through the SOCKS5 handshake.
+type State int
+
+const (
+	// NEW is the initial state of a connection before any data has
+	// been read from the client.
+	NEW State = iota
+	// INITIALIZING indicates that the method negotiation step has
+	// completed.
+	INITIALIZING
+	// CONNECTED indicates that the outbound connection has been
+	// established and the proxy is relaying traffic.
+	CONNECTED
+	// ERROR indicates that the connection has failed and an error
+	// reply has been sent to the client.
+	ERROR
+)
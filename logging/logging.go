@@ -0,0 +1,69 @@
+// Package logging provides a structured, level-aware Logger used
+// throughout the proxy and handler packages, decoupling callers
+// from a concrete logging backend. Each method takes a
+// human-readable message followed by alternating key/value pairs,
+// mirroring log/slog's convention.
+package logging
+
+import (
+	"log/slog"
+	"os"
+)
+
+// Logger is a structured, level-aware logger that can be bound to
+// a set of fields (e.g. a connection ID) via With, so every line
+// logged through the returned Logger carries them automatically.
+type Logger interface {
+	Debug(msg string, kv ...interface{})
+	Info(msg string, kv ...interface{})
+	Warn(msg string, kv ...interface{})
+	Error(msg string, kv ...interface{})
+	With(kv ...interface{}) Logger
+}
+
+// slogLogger is the default Logger backend, built on the standard
+// library's structured logger.
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// NewSlogLogger returns a Logger backed by log/slog.
+func NewSlogLogger(handler slog.Handler) Logger {
+	return &slogLogger{logger: slog.New(handler)}
+}
+
+func (l *slogLogger) Debug(msg string, kv ...interface{}) { l.logger.Debug(msg, kv...) }
+func (l *slogLogger) Info(msg string, kv ...interface{})  { l.logger.Info(msg, kv...) }
+func (l *slogLogger) Warn(msg string, kv ...interface{})  { l.logger.Warn(msg, kv...) }
+func (l *slogLogger) Error(msg string, kv ...interface{}) { l.logger.Error(msg, kv...) }
+
+func (l *slogLogger) With(kv ...interface{}) Logger {
+	return &slogLogger{logger: l.logger.With(kv...)}
+}
+
+// defaultLogger backs the package-level Debug/Info/Warn/Error
+// helpers, so call sites that don't need their own Logger instance
+// can keep using the package functions directly.
+var defaultLogger Logger = NewSlogLogger(slog.NewJSONHandler(os.Stderr, nil))
+
+// SetDefault overrides the package-level default Logger.
+func SetDefault(logger Logger) {
+	defaultLogger = logger
+}
+
+// Default returns the current package-level default Logger.
+func Default() Logger {
+	return defaultLogger
+}
+
+// Debug logs at debug level through the default Logger.
+func Debug(msg string, kv ...interface{}) { defaultLogger.Debug(msg, kv...) }
+
+// Info logs at info level through the default Logger.
+func Info(msg string, kv ...interface{}) { defaultLogger.Info(msg, kv...) }
+
+// Warn logs at warn level through the default Logger.
+func Warn(msg string, kv ...interface{}) { defaultLogger.Warn(msg, kv...) }
+
+// Error logs at error level through the default Logger.
+func Error(msg string, kv ...interface{}) { defaultLogger.Error(msg, kv...) }
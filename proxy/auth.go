@@ -0,0 +1,167 @@
+package proxy
+
+import (
+	"fmt"
+	"hiteshkotian/ssl-tunnel/handler"
+)
+
+// SOCKS5 authentication method bytes as defined in RFC 1928 section 3.
+const (
+	authNoAuth       = 0x00
+	authGSSAPI       = 0x01
+	authUserPass     = 0x02
+	authNoAcceptable = 0xFF
+)
+
+// Authenticator negotiates and verifies a single SOCKS5
+// authentication method.
+type Authenticator interface {
+	// Method returns the method byte this Authenticator handles.
+	Method() uint8
+	// Authenticate runs the method's exchange against the client
+	// and returns the authenticated identity, or an error if
+	// authentication failed.
+	Authenticate(request *handler.Request) (string, error)
+}
+
+// NoAuth implements the "NO AUTHENTICATION REQUIRED" method (0x00).
+// It performs no exchange and accepts every client.
+type NoAuth struct {
+}
+
+// Method returns authNoAuth.
+func (auth *NoAuth) Method() uint8 {
+	return authNoAuth
+}
+
+// Authenticate always succeeds for NoAuth.
+func (auth *NoAuth) Authenticate(request *handler.Request) (string, error) {
+	return "", nil
+}
+
+// CredentialStore validates a username/password pair on behalf of
+// UserPassAuth.
+type CredentialStore interface {
+	Valid(username, password string) bool
+}
+
+// StaticCredentialStore is a CredentialStore backed by an in-memory
+// map of username to password.
+type StaticCredentialStore map[string]string
+
+// Valid reports whether username/password matches an entry in the store.
+func (store StaticCredentialStore) Valid(username, password string) bool {
+	password2, ok := store[username]
+	return ok && password2 == password
+}
+
+// UserPassAuth implements the SOCKS5 username/password
+// authentication method (0x02) defined in RFC 1929.
+type UserPassAuth struct {
+	Credentials CredentialStore
+}
+
+// Method returns authUserPass.
+func (auth *UserPassAuth) Method() uint8 {
+	return authUserPass
+}
+
+// Authenticate reads VER, ULEN, UNAME, PLEN, PASSWD from the
+// client, validates the credentials against Credentials, and
+// replies with VER STATUS.
+func (auth *UserPassAuth) Authenticate(request *handler.Request) (string, error) {
+	header := make([]byte, 2)
+	if _, err := request.Read(header); err != nil {
+		return "", err
+	}
+
+	if header[0] != 0x01 {
+		return "", fmt.Errorf("unsupported username/password auth version %d", header[0])
+	}
+
+	uname := make([]byte, header[1])
+	if header[1] > 0 {
+		if _, err := request.Read(uname); err != nil {
+			return "", err
+		}
+	}
+
+	plen := make([]byte, 1)
+	if _, err := request.Read(plen); err != nil {
+		return "", err
+	}
+
+	passwd := make([]byte, plen[0])
+	if plen[0] > 0 {
+		if _, err := request.Read(passwd); err != nil {
+			return "", err
+		}
+	}
+
+	username := string(uname)
+	password := string(passwd)
+
+	if auth.Credentials == nil || !auth.Credentials.Valid(username, password) {
+		request.Write([]byte{0x01, 0x01})
+		return "", fmt.Errorf("invalid username or password")
+	}
+
+	request.Write([]byte{0x01, 0x00})
+	return username, nil
+}
+
+// GSSAPIAuth implements the SOCKS5 GSSAPI authentication method
+// (0x01) defined in RFC 1961 as a stub: the token exchange is not
+// implemented and Authenticate always fails. methodStrength ranks it
+// below every other method, so it is only selected for a client that
+// offers no other method the server accepts, and that client is then
+// rejected.
+type GSSAPIAuth struct {
+}
+
+// Method returns authGSSAPI.
+func (auth *GSSAPIAuth) Method() uint8 {
+	return authGSSAPI
+}
+
+// Authenticate always fails: GSSAPI token exchange is not
+// implemented yet.
+func (auth *GSSAPIAuth) Authenticate(request *handler.Request) (string, error) {
+	return "", fmt.Errorf("GSSAPI authentication is not yet implemented")
+}
+
+// selectAuthMethod picks the strongest method present in both the
+// client-offered methods and the server's configured authenticators.
+// It returns authNoAcceptable if there is no overlap.
+func (server *Server) selectAuthMethod(offered []byte) uint8 {
+	best := uint8(authNoAcceptable)
+	for _, method := range offered {
+		if _, ok := server.authenticators[method]; !ok {
+			continue
+		}
+		if best == authNoAcceptable || methodStrength(method) > methodStrength(best) {
+			best = method
+		}
+	}
+	return best
+}
+
+// methodStrength ranks authentication methods so the strongest
+// mutually supported one is selected. GSSAPI is ranked below every
+// other method, including NoAuth: GSSAPIAuth.Authenticate is a
+// permanent stub that always errors, so preferring it over any
+// method that can actually succeed -- NoAuth included -- would make
+// authentication fail for any client that offers both, regardless of
+// which order the client lists them in.
+func methodStrength(method uint8) int {
+	switch method {
+	case authUserPass:
+		return 2
+	case authNoAuth:
+		return 1
+	case authGSSAPI:
+		return -1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import "testing"
+
+func TestSelectAuthMethod(t *testing.T) {
+	server := New("test", 1080, 1, []Authenticator{&NoAuth{}, &UserPassAuth{}})
+
+	cases := []struct {
+		name    string
+		offered []byte
+		want    uint8
+	}{
+		{"empty methods", []byte{}, authNoAcceptable},
+		{"no overlap", []byte{authGSSAPI}, authNoAcceptable},
+		{"single supported method", []byte{authNoAuth}, authNoAuth},
+		{"picks the strongest of multiple offered", []byte{authNoAuth, authUserPass}, authUserPass},
+		{"ignores unsupported methods mixed in", []byte{authGSSAPI, authNoAuth}, authNoAuth},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			got := server.selectAuthMethod(testCase.offered)
+			if got != testCase.want {
+				t.Errorf("selectAuthMethod(%v) = 0x%02x, want 0x%02x", testCase.offered, got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestSelectAuthMethodPrefersWorkingMethodOverGSSAPIStub(t *testing.T) {
+	server := New("test", 1080, 1, []Authenticator{&NoAuth{}, &UserPassAuth{}, &GSSAPIAuth{}})
+
+	offered := []byte{authGSSAPI, authUserPass}
+	got := server.selectAuthMethod(offered)
+	if got != authUserPass {
+		t.Errorf("selectAuthMethod(%v) = 0x%02x, want 0x%02x (GSSAPI authentication always fails, it must not be preferred)", offered, got, authUserPass)
+	}
+}
+
+func TestSelectAuthMethodPrefersNoAuthOverGSSAPIStub(t *testing.T) {
+	server := New("test", 1080, 1, []Authenticator{&NoAuth{}, &GSSAPIAuth{}})
+
+	offered := []byte{authGSSAPI, authNoAuth}
+	got := server.selectAuthMethod(offered)
+	if got != authNoAuth {
+		t.Errorf("selectAuthMethod(%v) = 0x%02x, want 0x%02x (GSSAPI authentication always fails, it must not be preferred over NoAuth regardless of offer order)", offered, got, authNoAuth)
+	}
+}
+
+func TestSelectAuthMethodNoAuthenticatorsConfigured(t *testing.T) {
+	server := New("test", 1080, 1, nil)
+
+	got := server.selectAuthMethod([]byte{authNoAuth})
+	if got != authNoAuth {
+		t.Errorf("selectAuthMethod should fall back to NoAuth when none configured, got 0x%02x", got)
+	}
+}
+
+func TestStaticCredentialStore(t *testing.T) {
+	store := StaticCredentialStore{"alice": "hunter2"}
+
+	if !store.Valid("alice", "hunter2") {
+		t.Error("expected valid credentials to be accepted")
+	}
+	if store.Valid("alice", "wrong") {
+		t.Error("expected invalid password to be rejected")
+	}
+	if store.Valid("bob", "hunter2") {
+		t.Error("expected unknown username to be rejected")
+	}
+}
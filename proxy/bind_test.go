@@ -0,0 +1,136 @@
+package proxy
+
+import (
+	"hiteshkotian/ssl-tunnel/handler"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// readBindReply reads and minimally parses a SOCKS5 reply carrying
+// an IPv4 or IPv6 address, as written by writeBindReply.
+func readBindReply(t *testing.T, conn net.Conn) *net.TCPAddr {
+	t.Helper()
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		t.Fatalf("failed to read reply header: %v", err)
+	}
+	if header[0] != 0x05 || header[1] != 0x00 {
+		t.Fatalf("got reply header %v, want VER=0x05 STATUS=0x00", header)
+	}
+
+	ip := make([]byte, 4)
+	if header[3] == 0x04 {
+		ip = make([]byte, 16)
+	}
+	if _, err := io.ReadFull(conn, ip); err != nil {
+		t.Fatalf("failed to read reply address: %v", err)
+	}
+
+	port := make([]byte, 2)
+	if _, err := io.ReadFull(conn, port); err != nil {
+		t.Fatalf("failed to read reply port: %v", err)
+	}
+
+	return &net.TCPAddr{IP: net.IP(ip), Port: int(port[0])<<8 | int(port[1])}
+}
+
+// TestHandleBindCommandSendsTwoRepliesAndSplices covers the BIND
+// happy path: the first reply announces the listening address, a
+// peer connects back, and the second reply announces the peer's
+// address before the connection is handed off as the outbound leg.
+func TestHandleBindCommandSendsTwoRepliesAndSplices(t *testing.T) {
+	server := New("test", 0, 1, nil)
+
+	controlConn, controlPeer := net.Pipe()
+	defer controlConn.Close()
+	defer controlPeer.Close()
+
+	request := handler.NewRequest(controlConn, nil)
+
+	done := make(chan error, 1)
+	go func() { done <- server.handleBindCommand(request, SockRequest{}) }()
+
+	bindAddr := readBindReply(t, controlPeer)
+	if bindAddr.Port == 0 {
+		t.Fatalf("expected a non-zero bind port in the first reply")
+	}
+
+	peerConn, err := net.Dial("tcp", bindAddr.String())
+	if err != nil {
+		t.Fatalf("failed to connect back to the bind listener: %v", err)
+	}
+	defer peerConn.Close()
+
+	peerAddr := readBindReply(t, controlPeer)
+	if peerAddr.Port == 0 {
+		t.Fatalf("expected a non-zero peer port in the second reply")
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("handleBindCommand returned error: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("handleBindCommand did not return")
+	}
+
+	if request.OutboundConnection() == nil {
+		t.Fatal("expected the accepted peer to be recorded as the outbound connection")
+	}
+	if request.OutboundPort() != uint16(peerAddr.Port) {
+		t.Errorf("OutboundPort() = %d, want %d", request.OutboundPort(), peerAddr.Port)
+	}
+}
+
+// TestHandleBindCommandClearsDeadlineBeforeAcceptWait covers the
+// fixed-handshake-deadline regression: the control connection still
+// carries the short deadline set before dispatch in ServeTCP, but a
+// real BIND peer (e.g. active-mode FTP) can take far longer than that
+// to connect back. The second reply must not fail with an i/o
+// timeout just because the wait for the peer outlasted that deadline.
+func TestHandleBindCommandClearsDeadlineBeforeAcceptWait(t *testing.T) {
+	server := New("test", 0, 1, nil)
+
+	controlConn, controlPeer := net.Pipe()
+	defer controlConn.Close()
+	defer controlPeer.Close()
+	// Bounds how long reading the replies below can block, so a
+	// regression (the second reply never arriving) fails the test
+	// instead of hanging the suite.
+	controlPeer.SetDeadline(time.Now().Add(2 * time.Second))
+
+	// Simulate ServeTCP's short fixed deadline, set before dispatch.
+	controlConn.SetDeadline(time.Now().Add(50 * time.Millisecond))
+
+	request := handler.NewRequest(controlConn, nil)
+
+	done := make(chan error, 1)
+	go func() { done <- server.handleBindCommand(request, SockRequest{}) }()
+
+	bindAddr := readBindReply(t, controlPeer)
+
+	// Outlast the original deadline before the peer connects back, so
+	// a real peer only reachable after it would have expired.
+	time.Sleep(100 * time.Millisecond)
+
+	peerConn, err := net.Dial("tcp", bindAddr.String())
+	if err != nil {
+		t.Fatalf("failed to connect back to the bind listener: %v", err)
+	}
+	defer peerConn.Close()
+
+	readBindReply(t, controlPeer)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("handleBindCommand returned error: %v -- did the stale handshake deadline fire?", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("handleBindCommand did not return")
+	}
+}
@@ -0,0 +1,164 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	xproxy "golang.org/x/net/proxy"
+)
+
+// Dialer abstracts how the proxy reaches a destination, so a
+// connection can go direct, through another SOCKS5 proxy, through
+// an HTTP CONNECT proxy, or over an SSH bastion, and so several of
+// these can be chained together.
+type Dialer interface {
+	Dial(network, addr string) (net.Conn, error)
+}
+
+// DirectDialer dials destinations directly using net.Dial.
+type DirectDialer struct {
+}
+
+// Dial opens a direct connection to addr.
+func (dialer *DirectDialer) Dial(network, addr string) (net.Conn, error) {
+	return net.Dial(network, addr)
+}
+
+// SOCKS5Dialer chains the connection through an upstream SOCKS5
+// proxy, matching golang.org/x/net/proxy.SOCKS5 semantics. Forward
+// is used to reach the upstream proxy itself, so SOCKS5 proxies can
+// be chained A->B->C; it defaults to DirectDialer.
+type SOCKS5Dialer struct {
+	Address string
+	Auth    *xproxy.Auth
+	Forward Dialer
+}
+
+// Dial connects to addr via the configured upstream SOCKS5 proxy.
+func (dialer *SOCKS5Dialer) Dial(network, addr string) (net.Conn, error) {
+	forward := dialer.Forward
+	if forward == nil {
+		forward = &DirectDialer{}
+	}
+
+	upstream, err := xproxy.SOCKS5(network, dialer.Address, dialer.Auth, dialerAdapter{forward})
+	if err != nil {
+		return nil, err
+	}
+
+	return upstream.Dial(network, addr)
+}
+
+// dialerAdapter adapts our Dialer interface to the
+// golang.org/x/net/proxy.Dialer interface expected by xproxy.SOCKS5.
+type dialerAdapter struct {
+	dialer Dialer
+}
+
+func (adapter dialerAdapter) Dial(network, addr string) (net.Conn, error) {
+	return adapter.dialer.Dial(network, addr)
+}
+
+// HTTPConnectDialer chains the connection through an upstream HTTP
+// proxy using the CONNECT method.
+type HTTPConnectDialer struct {
+	Address string
+	Forward Dialer
+}
+
+// Dial opens a connection to the upstream proxy, issues
+// "CONNECT addr HTTP/1.1", and returns the tunnelled connection once
+// the proxy replies with a 200 status.
+func (dialer *HTTPConnectDialer) Dial(network, addr string) (net.Conn, error) {
+	forward := dialer.Forward
+	if forward == nil {
+		forward = &DirectDialer{}
+	}
+
+	conn, err := forward.Dial(network, dialer.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Fprintf(conn, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", addr, addr)
+
+	// Read through a bufio.Reader rather than a single fixed-size
+	// Read: the upstream proxy may pipeline the first bytes of the
+	// destination's data onto the same write as the 200 response, and
+	// http.ReadResponse only consumes the header, leaving any such
+	// bytes buffered rather than silently dropped.
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("upstream HTTP CONNECT proxy rejected request: %s", response.Status)
+	}
+
+	if reader.Buffered() == 0 {
+		return conn, nil
+	}
+	return &bufferedConn{Conn: conn, reader: reader}, nil
+}
+
+// bufferedConn wraps a net.Conn whose leading bytes have already
+// been consumed into a bufio.Reader (e.g. while parsing an HTTP
+// response that arrived in the same packet as the data that
+// follows it), replaying those buffered bytes before reading from
+// the underlying connection again.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read satisfies net.Conn by reading from the buffered reader, which
+// transparently falls through to the underlying connection once its
+// buffer is drained.
+func (conn *bufferedConn) Read(data []byte) (int, error) {
+	return conn.reader.Read(data)
+}
+
+// SSHDialer chains the connection through an SSH bastion, reaching
+// the destination from the bastion's network via client.Dial.
+type SSHDialer struct {
+	Address string
+	Config  *ssh.ClientConfig
+
+	dialOnce sync.Once
+	client   *ssh.Client
+	dialErr  error
+}
+
+// Dial lazily establishes the SSH connection to the bastion, then
+// asks it to dial the destination on our behalf. The same SSHDialer
+// is typically shared across every connection a Router sends down
+// this route, so the lazy connect is guarded by dialOnce instead of
+// a bare nil check to avoid concurrent first-uses racing on client.
+func (dialer *SSHDialer) Dial(network, addr string) (net.Conn, error) {
+	dialer.dialOnce.Do(func() {
+		dialer.client, dialer.dialErr = ssh.Dial("tcp", dialer.Address, dialer.Config)
+	})
+	if dialer.dialErr != nil {
+		return nil, dialer.dialErr
+	}
+
+	return dialer.client.Dial(network, addr)
+}
+
+// Close tears down the underlying SSH client connection, if one was
+// established.
+func (dialer *SSHDialer) Close() error {
+	if dialer.client == nil {
+		return nil
+	}
+	return dialer.client.Close()
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestHTTPConnectDialerSucceedsOn200(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		bufio.NewReader(conn).ReadString('\n')
+		conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
+	}()
+
+	dialer := &HTTPConnectDialer{Address: listener.Addr().String()}
+	conn, err := dialer.Dial("tcp", "example.com:443")
+	if err != nil {
+		t.Fatalf("Dial returned error: %v", err)
+	}
+	conn.Close()
+}
+
+// TestHTTPConnectDialerReplaysBytesPipelinedWithTheResponse covers an
+// upstream proxy that writes the 200 response and the first bytes of
+// the destination's data in a single Write -- legal and common. Those
+// leading bytes must reach the caller rather than being silently
+// dropped by whatever buffering parsed the response header.
+func TestHTTPConnectDialerReplaysBytesPipelinedWithTheResponse(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		bufio.NewReader(conn).ReadString('\n')
+		conn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\nHELLO-FROM-DEST"))
+	}()
+
+	dialer := &HTTPConnectDialer{Address: listener.Addr().String()}
+	conn, err := dialer.Dial("tcp", "example.com:443")
+	if err != nil {
+		t.Fatalf("Dial returned error: %v", err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, len("HELLO-FROM-DEST"))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("failed to read pipelined bytes: %v", err)
+	}
+	if string(buf) != "HELLO-FROM-DEST" {
+		t.Errorf("got %q, want %q", buf, "HELLO-FROM-DEST")
+	}
+}
+
+func TestHTTPConnectDialerFailsOnNon200(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		bufio.NewReader(conn).ReadString('\n')
+		conn.Write([]byte("HTTP/1.1 403 Forbidden\r\n\r\n"))
+	}()
+
+	dialer := &HTTPConnectDialer{Address: listener.Addr().String()}
+	if _, err := dialer.Dial("tcp", "example.com:443"); err == nil {
+		t.Fatal("expected a non-200 CONNECT response to be rejected")
+	}
+}
+
+// TestSSHDialerCachesConnectResultAcrossConcurrentCalls exercises the
+// lazy-connect path under concurrent first use -- the scenario in
+// which Router.DialerFor hands the same *SSHDialer to several
+// connections at once. Run with -race to confirm dialOnce actually
+// guards the shared client/dialErr fields.
+func TestSSHDialerCachesConnectResultAcrossConcurrentCalls(t *testing.T) {
+	dialer := &SSHDialer{
+		Address: "127.0.0.1:1",
+		Config: &ssh.ClientConfig{
+			User:            "test",
+			Auth:            []ssh.AuthMethod{ssh.Password("unused")},
+			HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+			Timeout:         time.Second,
+		},
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = dialer.Dial("tcp", "example.com:80")
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err == nil {
+			t.Fatalf("call %d: expected dialing an unreachable bastion to fail", i)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package proxy
+
+import (
+	"net"
+	"time"
+)
+
+// idleConn wraps a net.Conn and resets its deadline to idleTimeout
+// in the future on every successful read or write, so a long-lived
+// tunnel is only closed after it genuinely goes quiet rather than
+// after a fixed lifetime.
+type idleConn struct {
+	net.Conn
+	idleTimeout time.Duration
+}
+
+// newIdleConn wraps conn and arms its deadline immediately, rather
+// than leaving it unset until the first successful Read/Write. A
+// spliced connection that never exchanges a byte after the handshake
+// (and so never hits either method below) would otherwise block
+// forever instead of being reclaimed once it goes idle.
+func newIdleConn(conn net.Conn, idleTimeout time.Duration) *idleConn {
+	conn.SetDeadline(time.Now().Add(idleTimeout))
+	return &idleConn{Conn: conn, idleTimeout: idleTimeout}
+}
+
+func (conn *idleConn) Read(data []byte) (int, error) {
+	n, err := conn.Conn.Read(data)
+	if err == nil {
+		conn.Conn.SetDeadline(time.Now().Add(conn.idleTimeout))
+	}
+	return n, err
+}
+
+func (conn *idleConn) Write(data []byte) (int, error) {
+	n, err := conn.Conn.Write(data)
+	if err == nil {
+		conn.Conn.SetDeadline(time.Now().Add(conn.idleTimeout))
+	}
+	return n, err
+}
+
+// CloseWrite forwards to the wrapped conn's CloseWrite, if it has
+// one, so half-close support survives being wrapped in idleConn.
+func (conn *idleConn) CloseWrite() error {
+	if tc, ok := conn.Conn.(interface{ CloseWrite() error }); ok {
+		return tc.CloseWrite()
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+// TestNewIdleConnArmsInitialDeadline covers a spliced connection
+// that never exchanges a single byte after the handshake: without an
+// initial deadline, neither Read nor Write ever runs to reset it, so
+// the connection would never be reclaimed by the idle timeout this
+// type exists to enforce.
+func TestNewIdleConnArmsInitialDeadline(t *testing.T) {
+	serverSide, clientSide := net.Pipe()
+	defer clientSide.Close()
+
+	conn := newIdleConn(serverSide, 100*time.Millisecond)
+	defer conn.Close()
+
+	start := time.Now()
+	_, err := conn.Read(make([]byte, 1))
+	if err == nil {
+		t.Fatalf("expected idle timeout error, got nil")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Read took %v to time out, want well under the 1s test bound", elapsed)
+	}
+}
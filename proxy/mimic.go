@@ -0,0 +1,163 @@
+package proxy
+
+import (
+	"math/rand"
+	"net"
+)
+
+// Fingerprint identifies a TLS ClientHello wire profile to mimic
+// when outbound TLS mimicry is enabled.
+type Fingerprint int
+
+// Supported parroted ClientHello profiles.
+const (
+	FingerprintChrome Fingerprint = iota
+	FingerprintFirefox
+	FingerprintIOS
+)
+
+// fingerprintSplitPoints maps a Fingerprint to the byte offsets,
+// within the client's own ClientHello record, at which that
+// profile's real-world TLS stack tends to split the record across
+// multiple TCP segments. Splitting here never touches the record's
+// content -- it only changes how many writes (and therefore TCP
+// segments) it arrives as, which is enough to defeat naive
+// single-segment SNI sniffing without the proxy ever parsing or
+// regenerating the handshake itself.
+var fingerprintSplitPoints = map[Fingerprint][]int{
+	FingerprintChrome:  {1},
+	FingerprintFirefox: {},
+	FingerprintIOS:     {1, 6},
+}
+
+// FingerprintRoller picks a Fingerprint for each new MimicTLS
+// connection, so consecutive connections don't all present an
+// identical, and therefore fingerprintable, ClientHello framing.
+type FingerprintRoller interface {
+	Roll() Fingerprint
+}
+
+// defaultFingerprints is rolled across when a RandomFingerprintRoller
+// is not given an explicit set.
+var defaultFingerprints = []Fingerprint{FingerprintChrome, FingerprintFirefox, FingerprintIOS}
+
+// RandomFingerprintRoller rolls uniformly at random across Fingerprints.
+type RandomFingerprintRoller struct {
+	Fingerprints []Fingerprint
+}
+
+// Roll returns a uniformly random Fingerprint from the configured set.
+func (roller *RandomFingerprintRoller) Roll() Fingerprint {
+	fingerprints := roller.Fingerprints
+	if len(fingerprints) == 0 {
+		fingerprints = defaultFingerprints
+	}
+	return fingerprints[rand.Intn(len(fingerprints))]
+}
+
+// MimicTLSDialer wraps another Dialer and, for destinations on port
+// 443, splits the first Write the tunnelled client performs over the
+// returned connection -- its own genuine ClientHello -- across
+// several underlying writes at the offsets the selected Fingerprint
+// profile uses, instead of letting it go out as one TCP segment.
+//
+// This deliberately does not perform a TLS handshake of its own: the
+// SOCKS5 client is the real TLS client here, and the destination's
+// TLS session must stay end-to-end between the two of them. Earlier
+// revisions of this dialer terminated a uTLS handshake itself, which
+// made the proxy the destination's TLS peer and broke every ordinary
+// HTTPS CONNECT tunnel it handled; this version never reads or
+// rewrites a single handshake byte, it only changes how they're
+// segmented on the wire.
+type MimicTLSDialer struct {
+	Forward Dialer
+	Roller  FingerprintRoller
+}
+
+// Dial opens the underlying connection via Forward and, for port
+// 443, wraps it so the first Write is fragmented per the selected
+// Fingerprint's split points.
+func (dialer *MimicTLSDialer) Dial(network, addr string) (net.Conn, error) {
+	forward := dialer.Forward
+	if forward == nil {
+		forward = &DirectDialer{}
+	}
+
+	conn, err := forward.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil || port != "443" {
+		return conn, nil
+	}
+
+	return &fragmentingConn{Conn: conn, splits: dialer.splitPoints()}, nil
+}
+
+// splitPoints resolves the configured Roller's choice to a concrete
+// set of split offsets. With no Roller configured it rolls across
+// every profile via RandomFingerprintRoller; an unrecognised rolled
+// Fingerprint falls back to Chrome's split offsets.
+func (dialer *MimicTLSDialer) splitPoints() []int {
+	roller := dialer.Roller
+	if roller == nil {
+		roller = &RandomFingerprintRoller{}
+	}
+
+	splits, ok := fingerprintSplitPoints[roller.Roll()]
+	if !ok {
+		return fingerprintSplitPoints[FingerprintChrome]
+	}
+	return splits
+}
+
+// fragmentingConn wraps a net.Conn and splits only its first Write --
+// the client's ClientHello record -- into multiple underlying writes
+// at the configured byte offsets, then passes every later Write
+// through unmodified. The bytes it sends are always exactly the
+// bytes it was given; only their segmentation on the wire changes.
+type fragmentingConn struct {
+	net.Conn
+	splits     []int
+	fragmented bool
+}
+
+// Write fragments the first call per fragmentingConn.splits and
+// passes every subsequent call straight through.
+func (conn *fragmentingConn) Write(p []byte) (int, error) {
+	if conn.fragmented || len(conn.splits) == 0 {
+		return conn.Conn.Write(p)
+	}
+	conn.fragmented = true
+
+	written := 0
+	offset := 0
+	for _, split := range conn.splits {
+		if split <= offset || split >= len(p) {
+			continue
+		}
+		n, err := conn.Conn.Write(p[offset:split])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		offset = split
+	}
+
+	n, err := conn.Conn.Write(p[offset:])
+	written += n
+	return written, err
+}
+
+// EnableMimicTLS turns on outbound TLS ClientHello fragmentation
+// mimicry for connections to port 443, rolling the fingerprint for
+// each new connection via roller (defaults to RandomFingerprintRoller
+// across Chrome/Firefox/iOS if nil).
+func (server *Server) EnableMimicTLS(roller FingerprintRoller) {
+	if roller == nil {
+		roller = &RandomFingerprintRoller{}
+	}
+	server.mimicRoller = roller
+}
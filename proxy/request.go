@@ -0,0 +1,72 @@
+package proxy
+
+import "fmt"
+
+// SOCKS5 commands as defined in RFC 1928 section 4.
+const (
+	cmdConnect      = 0x01
+	cmdBind         = 0x02
+	cmdUDPAssociate = 0x03
+)
+
+// SockRequest represents a parsed SOCKS5 request header.
+type SockRequest struct {
+	ver      uint8
+	cmd      uint8
+	rsv      uint8
+	atype    uint8
+	destaddr []byte
+	destport uint16
+}
+
+// GetSocketRequestDeserialized parses the raw bytes of a SOCKS5
+// request (VER | CMD | RSV | ATYP | DST.ADDR | DST.PORT) into a
+// SockRequest.
+func GetSocketRequestDeserialized(data []byte) (SockRequest, error) {
+	if len(data) < 4 {
+		return SockRequest{}, fmt.Errorf("request too short")
+	}
+
+	request := SockRequest{
+		ver:   data[0],
+		cmd:   data[1],
+		rsv:   data[2],
+		atype: data[3],
+	}
+
+	offset := 4
+	switch request.atype {
+	case 0x01:
+		if len(data) < offset+4 {
+			return SockRequest{}, fmt.Errorf("request too short for IPv4 address")
+		}
+		request.destaddr = data[offset : offset+4]
+		offset += 4
+	case 0x03:
+		if len(data) < offset+1 {
+			return SockRequest{}, fmt.Errorf("request too short for domain length")
+		}
+		length := int(data[offset])
+		offset++
+		if len(data) < offset+length {
+			return SockRequest{}, fmt.Errorf("request too short for domain name")
+		}
+		request.destaddr = data[offset : offset+length]
+		offset += length
+	case 0x04:
+		if len(data) < offset+16 {
+			return SockRequest{}, fmt.Errorf("request too short for IPv6 address")
+		}
+		request.destaddr = data[offset : offset+16]
+		offset += 16
+	default:
+		return SockRequest{}, fmt.Errorf("unsupported address type %d", request.atype)
+	}
+
+	if len(data) < offset+2 {
+		return SockRequest{}, fmt.Errorf("request too short for port")
+	}
+	request.destport = uint16(data[offset])<<8 | uint16(data[offset+1])
+
+	return request, nil
+}
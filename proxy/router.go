@@ -0,0 +1,53 @@
+package proxy
+
+import "net"
+
+// Route matches a destination host against a suffix (e.g. ".onion")
+// or a CIDR block and, when it matches, selects the Dialer that
+// should be used to reach it.
+type Route struct {
+	// Suffix matches destination hosts ending in this string.
+	// Empty means this field is ignored.
+	Suffix string
+	// CIDR matches destination IPs contained in this network. Nil
+	// means this field is ignored.
+	CIDR *net.IPNet
+	// Dialer is used to reach destinations this route matches.
+	Dialer Dialer
+}
+
+// Router selects a Dialer for a destination host by walking an
+// ordered list of Routes, so different classes of traffic can be
+// sent through different upstream dialers, and falls back to
+// Default when nothing matches.
+type Router struct {
+	Routes  []Route
+	Default Dialer
+}
+
+// DialerFor returns the Dialer that should be used to reach host.
+func (router *Router) DialerFor(host string) Dialer {
+	ip := net.ParseIP(host)
+
+	for _, route := range router.Routes {
+		if route.Suffix != "" && hasSuffix(host, route.Suffix) {
+			return route.Dialer
+		}
+		if route.CIDR != nil && ip != nil && route.CIDR.Contains(ip) {
+			return route.Dialer
+		}
+	}
+
+	if router.Default != nil {
+		return router.Default
+	}
+
+	return &DirectDialer{}
+}
+
+func hasSuffix(host, suffix string) bool {
+	if len(host) < len(suffix) {
+		return false
+	}
+	return host[len(host)-len(suffix):] == suffix
+}
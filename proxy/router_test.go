@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+)
+
+func TestRouterDialerForMatchesSuffixThenCIDRThenDefault(t *testing.T) {
+	_, cidr, err := net.ParseCIDR("10.0.0.0/8")
+	if err != nil {
+		t.Fatalf("failed to parse CIDR: %v", err)
+	}
+
+	suffixDialer := &DirectDialer{}
+	cidrDialer := &DirectDialer{}
+	defaultDialer := &DirectDialer{}
+
+	router := &Router{
+		Routes: []Route{
+			{Suffix: ".onion", Dialer: suffixDialer},
+			{CIDR: cidr, Dialer: cidrDialer},
+		},
+		Default: defaultDialer,
+	}
+
+	cases := []struct {
+		name string
+		host string
+		want Dialer
+	}{
+		{"matches suffix", "example.onion", suffixDialer},
+		{"matches CIDR", "10.1.2.3", cidrDialer},
+		{"falls back to default", "example.com", defaultDialer},
+	}
+
+	for _, testCase := range cases {
+		t.Run(testCase.name, func(t *testing.T) {
+			if got := router.DialerFor(testCase.host); got != testCase.want {
+				t.Errorf("DialerFor(%q) = %v, want %v", testCase.host, got, testCase.want)
+			}
+		})
+	}
+}
+
+func TestRouterDialerForDefaultsToDirectDialerWhenUnset(t *testing.T) {
+	router := &Router{}
+
+	dialer := router.DialerFor("example.com")
+	if _, ok := dialer.(*DirectDialer); !ok {
+		t.Errorf("expected a *DirectDialer fallback, got %T", dialer)
+	}
+}
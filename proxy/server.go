@@ -1,13 +1,40 @@
 package proxy
 
 import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
 	"hiteshkotian/ssl-tunnel/handler"
 	"hiteshkotian/ssl-tunnel/logging"
+	"log/slog"
 	"net"
+	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
+// commandHandler processes a single SOCKS5 command (CONNECT, BIND or
+// UDP ASSOCIATE) once the request header has been parsed.
+type commandHandler func(request *handler.Request, connect SockRequest) error
+
+// handshakeTimeout bounds how long the SOCKS5 method negotiation and
+// command request may take before the connection is dropped.
+const handshakeTimeout = 10 * time.Second
+
+// defaultIdleTimeout is how long a spliced connection may sit idle,
+// in either direction, before it is closed.
+const defaultIdleTimeout = 5 * time.Minute
+
+// ConnStats summarizes a finished connection for consumers of the
+// stats hook (metrics, billing, auditing, ...).
+type ConnStats struct {
+	BytesUp   int64
+	BytesDown int64
+	Duration  time.Duration
+}
+
 // Server structure represents the main proxy instance
 type Server struct {
 	// Name of the server
@@ -25,36 +52,176 @@ type Server struct {
 	// Connection limiter. This channel ensures that at a given time the
 	// configured number of requests are being processed.
 	sem chan bool
+	// commands maps a SOCKS5 CMD byte to the handler responsible for
+	// it, so new commands can be registered without touching the
+	// dispatch logic in handleConnectRequest.
+	commands map[uint8]commandHandler
+	// authenticators maps a SOCKS5 method byte to the Authenticator
+	// responsible for it.
+	authenticators map[uint8]Authenticator
+	// router selects which Dialer is used to reach a given
+	// destination, so traffic can be chained through upstream
+	// proxies on a per-host basis.
+	router *Router
+	// idleTimeout governs the splice loop once the handshake is
+	// done; a connection is closed once it sees no traffic in
+	// either direction for this long.
+	idleTimeout time.Duration
+	// statsHook, if set, is invoked with a summary of each
+	// connection once its splice loop finishes.
+	statsHook func(ConnStats)
+	// tlsConfig, if set, wraps the accept listener in TLS so
+	// clients connect via SOCKS-over-TLS.
+	tlsConfig *TLSConfig
+	// mimicRoller, if set, enables outbound ClientHello
+	// fragmentation (see MimicTLSDialer) for connections to port
+	// 443. No uTLS handshake is performed and the ClientHello bytes
+	// are not rewritten.
+	mimicRoller FingerprintRoller
+	// logger is the base Logger every Request's per-connection
+	// logger is derived from, and the one the server's own log lines
+	// go through. Defaults to logging.Default(); override with
+	// SetLogger.
+	logger logging.Logger
+
+	shutdownCtx    context.Context
+	shutdownCancel context.CancelFunc
+	// closeOnce guards the accept-loop teardown (cancelling
+	// shutdownCtx and closing the listener) so it runs exactly once
+	// regardless of whether Stop or Shutdown is called, including
+	// more than once.
+	closeOnce sync.Once
+	// drainOnce guards starting the sem-draining goroutine below, so
+	// calling Shutdown more than once reuses the same drain instead
+	// of pushing into sem a second time and blocking forever.
+	drainOnce sync.Once
+	drained   chan struct{}
 }
 
-// New creats a new instance of the proxy
-func New(name string, port, maxConnectionCount int) *Server {
+// New creats a new instance of the proxy. authenticators registers
+// the SOCKS5 authentication methods the server is willing to
+// negotiate; if empty, the server falls back to NoAuth.
+func New(name string, port, maxConnectionCount int, authenticators []Authenticator) *Server {
 
 	proxy := &Server{name: name, port: port,
 		maxConnectionCount: maxConnectionCount}
 	proxy.connectHandler = make(chan net.Conn)
 	proxy.sem = make(chan bool, proxy.maxConnectionCount)
+	proxy.commands = map[uint8]commandHandler{
+		cmdConnect:      proxy.handleConnectCommand,
+		cmdBind:         proxy.handleBindCommand,
+		cmdUDPAssociate: proxy.handleUDPAssociateCommand,
+	}
+
+	if len(authenticators) == 0 {
+		authenticators = []Authenticator{&NoAuth{}}
+	}
+	proxy.authenticators = make(map[uint8]Authenticator, len(authenticators))
+	for _, authenticator := range authenticators {
+		proxy.authenticators[authenticator.Method()] = authenticator
+	}
+
+	proxy.router = &Router{Default: &DirectDialer{}}
+	proxy.idleTimeout = defaultIdleTimeout
+	proxy.logger = logging.Default()
+	proxy.shutdownCtx, proxy.shutdownCancel = context.WithCancel(context.Background())
+	proxy.drained = make(chan struct{})
 
 	return proxy
 }
 
-// NewFromConfig reads the provided config file and
-// returns a proxy instance
+// SetLogger overrides the base Logger this server and every Request
+// it creates derives its per-connection logger from. Defaults to
+// logging.Default().
+func (server *Server) SetLogger(logger logging.Logger) {
+	server.logger = logger
+}
+
+// SetRouter overrides the default direct-dialing Router, letting
+// callers chain destinations through upstream SOCKS5, HTTP CONNECT
+// or SSH dialers on a per-host or per-CIDR basis.
+func (server *Server) SetRouter(router *Router) {
+	server.router = router
+}
+
+// SetIdleTimeout overrides how long a spliced connection may sit
+// idle, in either direction, before it is closed.
+func (server *Server) SetIdleTimeout(timeout time.Duration) {
+	server.idleTimeout = timeout
+}
+
+// SetStatsHook registers a callback invoked with a summary of each
+// connection once its splice loop finishes.
+func (server *Server) SetStatsHook(hook func(ConnStats)) {
+	server.statsHook = hook
+}
+
+// Config is the on-disk representation read by NewFromConfig.
+type Config struct {
+	Name               string `json:"name"`
+	Port               int    `json:"port"`
+	MaxConnectionCount int    `json:"max_connection_count"`
+	// LogLevel selects the level of the server's default Logger:
+	// "debug", "info" (the default), "warn" or "error".
+	LogLevel string `json:"log_level"`
+}
+
+// NewFromConfig reads the provided config file and returns a proxy
+// instance, with its Logger built from the configured LogLevel and
+// threaded through to every Request it creates.
 func NewFromConfig(configPath string) (*Server, error) {
-	// TODO to implement this
-	return nil, nil
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var config Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	server := New(config.Name, config.Port, config.MaxConnectionCount, nil)
+	server.SetLogger(logging.NewSlogLogger(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+		Level: parseLogLevel(config.LogLevel),
+	})))
+
+	return server, nil
+}
+
+// parseLogLevel maps a config file's log_level string to a
+// slog.Level, defaulting to info for an empty or unrecognised value.
+func parseLogLevel(level string) slog.Level {
+	switch strings.ToLower(level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
 }
 
 // Start starts the server and accepts incoming client requests
 func (server *Server) Start() error {
 	var err error
-	logging.Info("Starting Proxy Server")
+	server.logger.Info("starting proxy server", "name", server.name, "port", server.port)
 	server.listener, err = net.Listen("tcp", fmt.Sprintf(":%d", server.port))
 	if err != nil {
-		logging.Error("Unable to start tcp server: ", err)
+		server.logger.Error("unable to start tcp server", "error", err)
 		return err
 	}
 
+	if server.tlsConfig != nil {
+		tlsConfig, err := buildTLSConfig(server.tlsConfig)
+		if err != nil {
+			server.logger.Error("unable to build TLS config", "error", err)
+			return err
+		}
+		server.listener = tls.NewListener(server.listener, tlsConfig)
+	}
+
 	return server.ServeTCP()
 }
 
@@ -69,20 +236,27 @@ func (server *Server) ServeTCP() error {
 		conn, err := server.listener.Accept()
 
 		if err != nil {
-			logging.Error("Erorr while reading incoming request", err)
+			server.logger.Error("error while accepting incoming connection", "error", err)
 			return err
 		}
 
-		logging.Debug("received connection request from %s",
-			conn.RemoteAddr().String())
+		server.logger.Debug("received connection request", "client_addr", conn.RemoteAddr().String())
 
-		// Set all the required timeouts
-		conn.SetReadDeadline(
-			time.Now().Add(10 * time.Second))
-		conn.SetWriteDeadline(
-			time.Now().Add(30 * time.Second))
+		// Only the handshake gets a short, fixed deadline; once it
+		// completes the connection switches to an idle timeout that
+		// resets on traffic, since SOCKS tunnels can live for hours.
+		conn.SetDeadline(time.Now().Add(handshakeTimeout))
 
-		server.connectHandler <- conn
+		// Accept() can return a connection concurrently with Stop or
+		// Shutdown tearing things down; racing the send against
+		// shutdownCtx instead of sending unconditionally avoids
+		// blocking forever once startHandler has stopped receiving.
+		select {
+		case server.connectHandler <- conn:
+		case <-server.shutdownCtx.Done():
+			conn.Close()
+			return nil
+		}
 	}
 }
 
@@ -91,12 +265,11 @@ func (server *Server) ServeTCP() error {
 func (server *Server) startHandler() {
 	for {
 		select {
-		case conn, more := <-server.connectHandler:
-			if !more {
-				return
-			}
+		case conn := <-server.connectHandler:
 			server.sem <- true
 			go server.handleRequest(conn, server.sem)
+		case <-server.shutdownCtx.Done():
+			return
 		}
 	}
 }
@@ -108,65 +281,121 @@ func (server *Server) startHandler() {
 // an appropriate error code to the client.
 func (server *Server) handleRequest(conn net.Conn, sem chan bool) error {
 
-	logging.Debug("Processing incoming client request")
-	request := handler.NewRequest(conn)
+	request := handler.NewRequest(conn, server.logger)
+	request.Logger().Debug("processing incoming client request")
 	defer request.Close()
+	defer func() { <-sem }()
 
 	err := server.handleInitial(request)
 	if err != nil {
-		server.sendSocksError(request)
-		<-sem
+		request.Logger().Warn("handshake failed", "error", err)
+		server.sendSocksError(request, 0x01)
 		return nil
 	}
 
-	// Writ accept
-	response := []byte{0x05, 0x00}
-	conn.Write(response)
-
 	// Wait for response
 	err = server.handleConnectRequest(request)
 	if err != nil {
-		logging.Error("Error handling connect request : ", err)
-		server.sendSocksError(request)
-		<-sem
+		request.Logger().Error("error handling connect request", "error", err)
+		server.sendSocksError(request, 0x01)
 		return nil
 	}
 
-	outboundHandler := handler.OutboundHandler{}
-	err = outboundHandler.HandleRequest(request)
+	// The handshake is done: drop the fixed deadline and splice
+	// under an idle timeout that resets on traffic in either
+	// direction instead.
+	conn.SetDeadline(time.Time{})
+	request.SetConn(newIdleConn(request.Conn(), server.idleTimeout))
+
+	spliceDone := make(chan struct{})
+	go func() {
+		select {
+		case <-server.shutdownCtx.Done():
+			request.Close()
+		case <-spliceDone:
+		}
+	}()
+
+	if request.OutboundConnection() != nil {
+		request.SetOutboundConnection(newIdleConn(request.OutboundConnection(), server.idleTimeout))
+		outboundHandler := handler.OutboundHandler{}
+		err = outboundHandler.HandleRequest(request)
+	} else {
+		// UDP ASSOCIATE has no outbound TCP connection to splice;
+		// the relay runs in its own goroutine and the control
+		// connection just needs to be held open until the client
+		// closes it, which tears the relay down via request.Close().
+		_, err = request.Conn().Read(make([]byte, 1))
+	}
+	close(spliceDone)
+
+	if server.statsHook != nil {
+		server.statsHook(ConnStats{
+			BytesUp:   request.BytesUp(),
+			BytesDown: request.BytesDown(),
+			Duration:  request.Elapsed(),
+		})
+	}
+
 	if err != nil {
-		logging.Error("Error while sending request : %s\n", err)
-		server.sendSocksError(request)
-		<-sem
+		request.Logger().Error("error while relaying request", "error", err)
+		server.sendSocksError(request, 0x01)
 		return nil
 	}
 
-	<-sem
+	request.Logger().Info("connection closed",
+		"dest_addr", request.OutboundIP(),
+		"dest_port", request.OutboundPort(),
+		"atype", request.Atype(),
+		"bytes_up", request.BytesUp(),
+		"bytes_down", request.BytesDown(),
+		"duration_ms", request.Elapsed().Milliseconds())
+
 	return nil
 }
 
+// handleInitial negotiates the authentication method with the
+// client per RFC 1928 section 3: read VER, NMETHODS and METHODS[],
+// pick the strongest method the server and client both support,
+// reply with the selected byte (or 0xFF if none is acceptable), and
+// then run that method's authentication exchange.
 func (server *Server) handleInitial(request *handler.Request) error {
-	data := make([]byte, 20)
-	n, e := request.Read(data)
-	if e != nil {
-		return e
+	header := make([]byte, 2)
+	if _, err := request.Read(header); err != nil {
+		return err
 	}
 
-	version := data[0]
-	authCt := data[1]
-	logging.Debug("Total num : %d", n)
-	logging.Debug("Received connect with version : %d", version)
-	logging.Debug("Received connect with auth ct : %d", authCt)
+	version := header[0]
+	nmethods := header[1]
+	request.Logger().Debug("received method negotiation", "version", version, "method_count", nmethods)
 
 	if version != 0x05 {
-		logging.Error("Version mismatch",
-			fmt.Errorf("Version expeted was 0x05 but received %d", version))
-	} else {
-		logging.Debug("Version matched!!!")
+		return fmt.Errorf("Version expeted was 0x05 but received %d", version)
 	}
-	for i := 0; i < n; i++ {
-		logging.Debug("0x%02x ", data[i])
+
+	methods := make([]byte, nmethods)
+	if nmethods > 0 {
+		if _, err := request.Read(methods); err != nil {
+			return err
+		}
 	}
+
+	selected := server.selectAuthMethod(methods)
+	if _, err := request.Write([]byte{0x05, selected}); err != nil {
+		return err
+	}
+
+	if selected == authNoAcceptable {
+		return fmt.Errorf("No acceptable authentication method offered")
+	}
+
+	authenticator := server.authenticators[selected]
+	identity, err := authenticator.Authenticate(request)
+	if err != nil {
+		return err
+	}
+
+	request.SetIdentity(identity)
 	request.SetState(handler.INITIALIZING)
 
 	return nil
@@ -174,61 +403,63 @@ func (server *Server) handleInitial(request *handler.Request) error {
 
 func (server *Server) handleConnectRequest(request *handler.Request) error {
 	data := make([]byte, 200)
-	_, err := request.Read(data)
+	n, err := request.Read(data)
 
 	if err != nil {
-		logging.Error("error reading request", err)
+		request.Logger().Error("error reading request", "error", err)
 		return err
 	}
 
+	// A single hex-encoded field instead of a per-byte dump, so the
+	// raw request is still inspectable at debug level without
+	// flooding the log with one line per byte.
+	request.Logger().Debug("received connect request", "raw", fmt.Sprintf("%x", data[:n]))
+
 	connect, err := GetSocketRequestDeserialized(data)
 	if err != nil {
-		logging.Error("Connect request error", err)
+		request.Logger().Error("connect request error", "error", err)
 		return err
 	}
 
-	var outConnection net.Conn
-	if connect.atype == 0x01 {
-		ip := fmt.Sprintf("%d.%d.%d.%d", connect.destaddr[0],
-			connect.destaddr[1], connect.destaddr[2], connect.destaddr[3])
-		request.SetOutboundIP(ip)
-		outConnection, err = net.Dial("tcp", fmt.Sprintf("%s:%d", ip, connect.destport))
-		if err != nil {
-			return err
-		}
+	request.SetAtype(connect.atype)
 
-		request.SetOutboundConnection(outConnection)
-	} else if connect.atype == 0x03 {
-		addr, err := net.LookupHost(string(connect.destaddr))
-		if err != nil {
-			return err
-		}
+	handleCommand, ok := server.commands[connect.cmd]
+	if !ok {
+		server.sendSocksConnectError(request, 0x07, &connect)
+		return fmt.Errorf("Unsupported command %d", connect.cmd)
+	}
 
-		host := fmt.Sprintf("%s:%d", addr[0], connect.destport)
-		outConnection, err = net.Dial("tcp", host)
-		if err != nil {
-			return err
-		}
+	return handleCommand(request, connect)
+}
 
-		request.SetOutboundConnection(outConnection)
-	} else if connect.atype == 0x04 {
-		ip := net.IP(connect.destaddr)
-		ipAddr := ip.String()
-		// logging.Debug("Connecting to [%s]:%d\n", ipAddr, connect.destport)
-		request.SetOutboundIP(ipAddr)
-		outConnection, err = net.Dial("tcp6", fmt.Sprintf("[%s]:%d", ipAddr, connect.destport))
-		if err != nil {
-			return err
-		}
-		request.SetOutboundConnection(outConnection)
-	} else {
-		// logging.Info("Connection type %d not supported", connect.atype)
-		// return fmt.Errorf("Unsupported connection type")
+// handleConnectCommand dials the requested destination through
+// whichever Dialer server.router selects for it, and splices the
+// client to it, per RFC 1928 CMD=0x01 (CONNECT).
+func (server *Server) handleConnectCommand(request *handler.Request, connect SockRequest) error {
+	host, network, err := destinationAddr(connect)
+	if err != nil {
 		server.sendSocksConnectError(request, 0x08, &connect)
-		return fmt.Errorf("Unsupported connection type")
+		return err
 	}
-
+	request.SetOutboundIP(host)
 	request.SetOutboundPort(connect.destport)
+	request.SetLogger(request.Logger().With("dest_addr", host, "dest_port", connect.destport, "atype", connect.atype))
+
+	addr := fmt.Sprintf("%s:%d", host, connect.destport)
+	if network == "tcp6" {
+		addr = fmt.Sprintf("[%s]:%d", host, connect.destport)
+	}
+
+	dialer := server.router.DialerFor(host)
+	if server.mimicRoller != nil {
+		dialer = &MimicTLSDialer{Forward: dialer, Roller: server.mimicRoller}
+	}
+	outConnection, err := dialer.Dial(network, addr)
+	if err != nil {
+		return err
+	}
+
+	request.SetOutboundConnection(outConnection)
 
 	dest := connect.destaddr
 	port := []byte{0x00, 0x50}
@@ -245,17 +476,243 @@ func (server *Server) handleConnectRequest(request *handler.Request) error {
 	return nil
 }
 
+// destinationAddr turns a parsed SockRequest's address fields into
+// the host string and the network ("tcp" or "tcp6") it should be
+// dialed on.
+func destinationAddr(connect SockRequest) (string, string, error) {
+	switch connect.atype {
+	case 0x01:
+		ip := fmt.Sprintf("%d.%d.%d.%d", connect.destaddr[0],
+			connect.destaddr[1], connect.destaddr[2], connect.destaddr[3])
+		return ip, "tcp", nil
+	case 0x03:
+		return string(connect.destaddr), "tcp", nil
+	case 0x04:
+		return net.IP(connect.destaddr).String(), "tcp6", nil
+	default:
+		return "", "", fmt.Errorf("Unsupported connection type")
+	}
+}
+
+// handleBindCommand implements RFC 1928 CMD=0x02 (BIND), used by
+// protocols such as active-mode FTP where the destination connects
+// back to the proxy. It opens a listening socket, reports its
+// address in the first reply, then waits for the peer to connect
+// and reports its address in a second reply before splicing.
+func (server *Server) handleBindCommand(request *handler.Request, connect SockRequest) error {
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	bindAddr := listener.Addr().(*net.TCPAddr)
+	if err := writeBindReply(request, 0x00, bindAddr); err != nil {
+		return err
+	}
+
+	// The control connection still carries the fixed handshakeTimeout
+	// deadline set before dispatch in ServeTCP, but the peer
+	// connecting back (e.g. active-mode FTP's data connection) is
+	// under no such bound. Clear it before the unbounded Accept wait
+	// so the second reply below isn't written to a connection whose
+	// deadline expired while we were waiting.
+	request.Conn().SetDeadline(time.Time{})
+
+	peer, err := listener.Accept()
+	if err != nil {
+		return err
+	}
+
+	peerAddr := peer.RemoteAddr().(*net.TCPAddr)
+	if err := writeBindReply(request, 0x00, peerAddr); err != nil {
+		peer.Close()
+		return err
+	}
+
+	request.SetOutboundConnection(peer)
+	request.SetOutboundIP(peerAddr.IP.String())
+	request.SetOutboundPort(uint16(peerAddr.Port))
+
+	return nil
+}
+
+// handleUDPAssociateCommand implements RFC 1928 CMD=0x03 (UDP
+// ASSOCIATE). It opens a UDP relay socket, reports its address to
+// the client, then relays datagrams between the client and the
+// destinations it asks for until the TCP control connection closes.
+func (server *Server) handleUDPAssociateCommand(request *handler.Request, connect SockRequest) error {
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{Port: 0})
+	if err != nil {
+		return err
+	}
+
+	relayAddr := relay.LocalAddr().(*net.UDPAddr)
+	if err := writeBindReply(request, 0x00, &net.TCPAddr{IP: relayAddr.IP, Port: relayAddr.Port}); err != nil {
+		relay.Close()
+		return err
+	}
+
+	request.SetUDPRelay(relay)
+	go server.relayUDP(relay)
+
+	return nil
+}
+
+// relayUDP forwards datagrams received on the relay socket from the
+// client to whichever destination each datagram's SOCKS UDP header
+// names, and wraps replies from that destination with the same
+// header before returning them to the client. Each distinct
+// destination gets its own outbound socket and reply goroutine, so a
+// client associating to more than one destination over the same
+// relay is routed correctly instead of being pinned to whichever
+// destination the first datagram named.
+func (server *Server) relayUDP(relay *net.UDPConn) {
+	buf := make([]byte, 65507)
+	var clientAddr *net.UDPAddr
+	destConns := make(map[string]*net.UDPConn)
+	defer func() {
+		for _, destConn := range destConns {
+			destConn.Close()
+		}
+	}()
+
+	for {
+		n, addr, err := relay.ReadFromUDP(buf)
+		if err != nil {
+			server.logger.Debug("UDP relay closed", "error", err)
+			return
+		}
+
+		if clientAddr == nil {
+			clientAddr = addr
+		}
+		if addr.String() != clientAddr.String() {
+			continue
+		}
+
+		header, payload, err := parseUDPHeader(buf[:n])
+		if err != nil {
+			server.logger.Debug("dropping malformed UDP datagram", "error", err)
+			continue
+		}
+		// parseUDPHeader's destIP aliases buf, which is reused on
+		// every iteration; copy it before handing the header to the
+		// long-lived reply goroutine below.
+		header.destIP = append(net.IP(nil), header.destIP...)
+
+		destKey := net.JoinHostPort(header.destIP.String(), fmt.Sprint(header.destPort))
+		destConn, ok := destConns[destKey]
+		if !ok {
+			destConn, err = net.DialUDP("udp", nil, &net.UDPAddr{IP: header.destIP, Port: int(header.destPort)})
+			if err != nil {
+				server.logger.Error("unable to dial UDP destination", "error", err)
+				continue
+			}
+			destConns[destKey] = destConn
+			go server.relayUDPReplies(relay, destConn, clientAddr, header)
+		}
+
+		destConn.Write(payload)
+	}
+}
+
+// relayUDPReplies reads datagrams coming back from a single
+// destination and returns them to the client wrapped in a SOCKS UDP
+// header.
+func (server *Server) relayUDPReplies(relay *net.UDPConn, destConn *net.UDPConn, clientAddr *net.UDPAddr, header udpHeader) {
+	defer destConn.Close()
+
+	buf := make([]byte, 65507)
+	for {
+		n, err := destConn.Read(buf)
+		if err != nil {
+			return
+		}
+
+		reply := wrapUDPHeader(header, buf[:n])
+		if _, err := relay.WriteToUDP(reply, clientAddr); err != nil {
+			return
+		}
+	}
+}
+
+// writeBindReply writes a SOCKS5 reply carrying the given address,
+// used for both BIND replies and the UDP ASSOCIATE reply.
+func writeBindReply(request *handler.Request, status uint8, addr *net.TCPAddr) error {
+	atype := byte(0x01)
+	ip := addr.IP.To4()
+	if ip == nil {
+		atype = 0x04
+		ip = addr.IP.To16()
+	}
+
+	resp := make([]byte, 4+len(ip)+2)
+	resp[0] = 0x05
+	resp[1] = status
+	resp[2] = 0x00
+	resp[3] = atype
+	copy(resp[4:], ip)
+	resp[4+len(ip)] = byte(addr.Port >> 8)
+	resp[4+len(ip)+1] = byte(addr.Port)
+
+	_, err := request.Write(resp)
+	return err
+}
+
+// closeAccept cancels shutdownCtx and closes the listener exactly
+// once, however many times, and in whatever combination, Stop and
+// Shutdown are called. connectHandler is deliberately never closed:
+// it has multiple producers (ServeTCP and any WebSocketServer
+// wrapping this Server), and closing a channel a producer may still
+// be sending to races that send -- shutdownCtx.Done() is the single
+// source of truth for "stop accepting" that every producer and
+// startHandler select on instead.
+func (server *Server) closeAccept() {
+	server.closeOnce.Do(func() {
+		server.shutdownCancel()
+		server.listener.Close()
+	})
+}
+
 // Stop stops the server
 func (server *Server) Stop() {
-	// Closing Channel
-	logging.Info("Stopping Proxy Server")
-	close(server.connectHandler)
-	server.listener.Close()
+	server.logger.Info("stopping proxy server", "name", server.name)
+	server.closeAccept()
+}
+
+// Shutdown stops the server from accepting new connections and
+// cancels the shutdown context, which closes the connections of every
+// in-flight splice loop, then waits for every connection handler to
+// finish, analogous to net/http.Server.Shutdown. If ctx is done
+// first it returns ctx.Err(); it closes nothing further at that
+// point.
+func (server *Server) Shutdown(ctx context.Context) error {
+	server.logger.Info("shutting down proxy server", "name", server.name)
+
+	server.closeAccept()
+
+	server.drainOnce.Do(func() {
+		go func() {
+			for i := 0; i < server.maxConnectionCount; i++ {
+				server.sem <- true
+			}
+			close(server.drained)
+		}()
+	})
+
+	select {
+	case <-server.drained:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
-func (server *Server) sendSocksError(request *handler.Request) {
+func (server *Server) sendSocksError(request *handler.Request, status uint8) {
 	// state := request.State()
 	request.SetState(handler.ERROR)
+	request.Logger().Warn("sending socks error", "socks_error_code", status)
 	var errorStream []byte
 	// switch state {
 	// case handler.NEW:
@@ -266,7 +723,7 @@ func (server *Server) sendSocksError(request *handler.Request) {
 	// +-----+-------+
 	// | VER | STATE |
 	// +-----+-------+
-	errorStream = []byte{0x05, 0x01}
+	errorStream = []byte{0x05, status}
 	// default:
 	// Sending INIT error
 	// Format :
@@ -282,6 +739,7 @@ func (server *Server) sendSocksError(request *handler.Request) {
 
 func (server *Server) sendSocksConnectError(request *handler.Request, status uint8, req *SockRequest) {
 	request.SetState(handler.ERROR)
+	request.Logger().Warn("sending socks connect error", "socks_error_code", status)
 
 	var errorStream []byte
 	// other := new(bytes.Buffer)
@@ -0,0 +1,45 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestServerStopAndShutdownAreIdempotentAndSafeTogether guards
+// against the panics this request's graceful shutdown support
+// introduced: closing connectHandler/listener more than once, and
+// Stop/Shutdown racing a concurrent ServeTCP send on connectHandler.
+func TestServerStopAndShutdownAreIdempotentAndSafeTogether(t *testing.T) {
+	server := New("test", 0, 1, nil)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server.listener = listener
+
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.ServeTCP() }()
+
+	// Give ServeTCP a moment to reach Accept() before tearing down.
+	time.Sleep(10 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); server.Stop() }()
+	go func() { defer wg.Done(); server.Shutdown(context.Background()) }()
+	wg.Wait()
+
+	// Calling either again must still not panic.
+	server.Stop()
+	server.Shutdown(context.Background())
+
+	select {
+	case <-serveErr:
+	case <-time.After(2 * time.Second):
+		t.Fatal("ServeTCP did not return after shutdown")
+	}
+}
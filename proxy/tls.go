@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+)
+
+// TLSConfig configures the optional TLS front-end for the SOCKS5
+// listener, letting clients connect via SOCKS-over-TLS instead of
+// plain TCP.
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile, if set, enables mutual TLS: only clients
+	// presenting a certificate signed by this CA are accepted.
+	ClientCAFile string
+}
+
+// SetTLSConfig wraps the server's accept listener in TLS once Start
+// is called.
+func (server *Server) SetTLSConfig(config *TLSConfig) {
+	server.tlsConfig = config
+}
+
+// buildTLSConfig loads the configured certificate/key pair and,
+// when ClientCAFile is set, configures mutual TLS.
+func buildTLSConfig(config *TLSConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{Certificates: []tls.Certificate{cert}}
+
+	if config.ClientCAFile != "" {
+		caCert, err := os.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caCert) {
+			return nil, fmt.Errorf("unable to parse client CA certificate")
+		}
+
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert generates a self-signed ECDSA certificate/key
+// pair valid for "127.0.0.1", writes them as PEM files under dir, and
+// returns their paths.
+func writeSelfSignedCert(t *testing.T, dir, name string) (certPath, keyPath string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %v", err)
+	}
+
+	certPath = filepath.Join(dir, name+"-cert.pem")
+	keyPath = filepath.Join(dir, name+"-key.pem")
+
+	certOut, err := os.Create(certPath)
+	if err != nil {
+		t.Fatalf("failed to create cert file: %v", err)
+	}
+	defer certOut.Close()
+	pem.Encode(certOut, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	keyOut, err := os.Create(keyPath)
+	if err != nil {
+		t.Fatalf("failed to create key file: %v", err)
+	}
+	defer keyOut.Close()
+	pem.Encode(keyOut, &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+
+	return certPath, keyPath
+}
+
+// TestBuildTLSConfigServesHandshakeAndData covers the plain (non
+// mutual) case: a listener wrapped via buildTLSConfig completes a
+// handshake with an ordinary TLS client and carries data normally.
+func TestBuildTLSConfigServesHandshakeAndData(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeSelfSignedCert(t, dir, "server")
+
+	tlsConfig, err := buildTLSConfig(&TLSConfig{CertFile: certPath, KeyFile: keyPath})
+	if err != nil {
+		t.Fatalf("buildTLSConfig returned error: %v", err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	serverDone := make(chan error, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			serverDone <- err
+			return
+		}
+		defer conn.Close()
+		_, err = conn.Write([]byte("hello"))
+		serverDone <- err
+	}()
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatalf("client Dial failed: %v", err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, len("hello"))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatalf("failed to read from server: %v", err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("got %q, want %q", buf, "hello")
+	}
+
+	if err := <-serverDone; err != nil {
+		t.Fatalf("server side failed: %v", err)
+	}
+}
+
+// TestBuildTLSConfigRejectsClientWithoutCertWhenMutualTLSEnabled
+// covers the ClientCAFile path: once set, a client that doesn't
+// present a certificate signed by that CA must be rejected during
+// the handshake rather than let through.
+func TestBuildTLSConfigRejectsClientWithoutCertWhenMutualTLSEnabled(t *testing.T) {
+	dir := t.TempDir()
+	serverCertPath, serverKeyPath := writeSelfSignedCert(t, dir, "server")
+	clientCACertPath, _ := writeSelfSignedCert(t, dir, "client-ca")
+
+	tlsConfig, err := buildTLSConfig(&TLSConfig{
+		CertFile:     serverCertPath,
+		KeyFile:      serverKeyPath,
+		ClientCAFile: clientCACertPath,
+	})
+	if err != nil {
+		t.Fatalf("buildTLSConfig returned error: %v", err)
+	}
+
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", tlsConfig)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		// Accept() on a tls.Listener returns before the handshake
+		// completes; force it so the rejection happens here instead
+		// of silently on whatever later Read/Write would trigger it.
+		conn.(*tls.Conn).Handshake()
+	}()
+
+	// No client certificate is presented, even though ClientCAFile
+	// requires one.
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		// Rejected at Dial time -- also an acceptable outcome.
+		return
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("x")); err == nil {
+		if _, err := conn.Read(make([]byte, 1)); err == nil {
+			t.Fatal("expected the handshake to be rejected without a client certificate")
+		}
+	}
+}
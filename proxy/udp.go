@@ -0,0 +1,95 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+)
+
+// udpHeader represents the SOCKS UDP request header defined in
+// RFC 1928 section 7: RSV(2) | FRAG(1) | ATYP(1) | DST.ADDR | DST.PORT.
+type udpHeader struct {
+	atype    uint8
+	destIP   net.IP
+	destPort uint16
+}
+
+// parseUDPHeader strips the SOCKS UDP header off a datagram received
+// from the client and returns the destination it describes along
+// with the remaining payload.
+func parseUDPHeader(data []byte) (udpHeader, []byte, error) {
+	if len(data) < 4 {
+		return udpHeader{}, nil, fmt.Errorf("datagram too short")
+	}
+
+	if data[2] != 0x00 {
+		return udpHeader{}, nil, fmt.Errorf("fragmented UDP datagrams are not supported")
+	}
+
+	atype := data[3]
+	offset := 4
+	var ip net.IP
+
+	switch atype {
+	case 0x01:
+		if len(data) < offset+4 {
+			return udpHeader{}, nil, fmt.Errorf("datagram too short for IPv4 address")
+		}
+		ip = net.IP(data[offset : offset+4])
+		offset += 4
+	case 0x03:
+		if len(data) < offset+1 {
+			return udpHeader{}, nil, fmt.Errorf("datagram too short for domain length")
+		}
+		length := int(data[offset])
+		offset++
+		if len(data) < offset+length {
+			return udpHeader{}, nil, fmt.Errorf("datagram too short for domain name")
+		}
+		host := string(data[offset : offset+length])
+		offset += length
+
+		addrs, err := net.LookupHost(host)
+		if err != nil {
+			return udpHeader{}, nil, err
+		}
+		ip = net.ParseIP(addrs[0])
+	case 0x04:
+		if len(data) < offset+16 {
+			return udpHeader{}, nil, fmt.Errorf("datagram too short for IPv6 address")
+		}
+		ip = net.IP(data[offset : offset+16])
+		offset += 16
+	default:
+		return udpHeader{}, nil, fmt.Errorf("unsupported address type %d", atype)
+	}
+
+	if len(data) < offset+2 {
+		return udpHeader{}, nil, fmt.Errorf("datagram too short for port")
+	}
+	port := uint16(data[offset])<<8 | uint16(data[offset+1])
+	offset += 2
+
+	return udpHeader{atype: atype, destIP: ip, destPort: port}, data[offset:], nil
+}
+
+// wrapUDPHeader prepends a SOCKS UDP header describing the reply's
+// origin (the destination that was relayed to) onto the payload
+// before it is returned to the client.
+func wrapUDPHeader(header udpHeader, payload []byte) []byte {
+	atype := byte(0x01)
+	ip := header.destIP.To4()
+	if ip == nil {
+		atype = 0x04
+		ip = header.destIP.To16()
+	}
+
+	packet := make([]byte, 4+len(ip)+2+len(payload))
+	packet[2] = 0x00
+	packet[3] = atype
+	copy(packet[4:], ip)
+	packet[4+len(ip)] = byte(header.destPort >> 8)
+	packet[4+len(ip)+1] = byte(header.destPort)
+	copy(packet[4+len(ip)+2:], payload)
+
+	return packet
+}
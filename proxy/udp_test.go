@@ -0,0 +1,103 @@
+package proxy
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+)
+
+// echoUDPServer opens a UDP socket that echoes back whatever it
+// receives, prefixed so replies from different servers are
+// distinguishable.
+func echoUDPServer(t *testing.T, tag byte) *net.UDPConn {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to start echo server: %v", err)
+	}
+
+	go func() {
+		buf := make([]byte, 65507)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			reply := append([]byte{tag}, buf[:n]...)
+			conn.WriteToUDP(reply, addr)
+		}
+	}()
+
+	return conn
+}
+
+func TestRelayUDPRoutesEachDatagramToItsOwnDestination(t *testing.T) {
+	echoA := echoUDPServer(t, 0xAA)
+	defer echoA.Close()
+	echoB := echoUDPServer(t, 0xBB)
+	defer echoB.Close()
+
+	relay, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to start relay: %v", err)
+	}
+	defer relay.Close()
+
+	server := New("test", 0, 1, nil)
+	go server.relayUDP(relay)
+
+	client, err := net.DialUDP("udp", nil, relay.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("failed to dial relay: %v", err)
+	}
+	defer client.Close()
+
+	addrA := echoA.LocalAddr().(*net.UDPAddr)
+	addrB := echoB.LocalAddr().(*net.UDPAddr)
+
+	datagramTo := func(addr *net.UDPAddr, payload []byte) []byte {
+		header := udpHeader{atype: 0x01, destIP: addr.IP, destPort: uint16(addr.Port)}
+		return wrapUDPHeader(header, payload)
+	}
+
+	// Send to B first, then to A, so a relay that pins itself to the
+	// first-seen destination would misroute the second datagram.
+	if _, err := client.Write(datagramTo(addrB, []byte("to-b"))); err != nil {
+		t.Fatalf("write to B failed: %v", err)
+	}
+	if _, err := client.Write(datagramTo(addrA, []byte("to-a"))); err != nil {
+		t.Fatalf("write to A failed: %v", err)
+	}
+
+	client.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	seen := map[byte]bool{}
+	buf := make([]byte, 65507)
+	for i := 0; i < 2; i++ {
+		n, err := client.Read(buf)
+		if err != nil {
+			t.Fatalf("failed to read reply %d: %v", i, err)
+		}
+		_, payload, err := parseUDPHeader(buf[:n])
+		if err != nil {
+			t.Fatalf("failed to parse reply header: %v", err)
+		}
+		if len(payload) == 0 {
+			t.Fatalf("reply %d had no payload", i)
+		}
+		seen[payload[0]] = true
+
+		want := []byte("to-a")
+		if payload[0] == 0xBB {
+			want = []byte("to-b")
+		}
+		if !bytes.Equal(payload[1:], want) {
+			t.Errorf("reply tagged 0x%02x carried payload %q, want %q", payload[0], payload[1:], want)
+		}
+	}
+
+	if !seen[0xAA] || !seen[0xBB] {
+		t.Fatalf("expected replies from both destinations, got tags %v", seen)
+	}
+}
@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// websocketSubprotocol is negotiated on both ends so a WebSocket
+// upgrade request can be recognised as carrying a SOCKS5 session.
+const websocketSubprotocol = "socks5"
+
+// WebSocketServer accepts SOCKS5 sessions tunnelled inside WebSocket
+// connections on a configurable HTTP path, so the proxy can be
+// deployed behind reverse proxies/CDNs and reached from browsers or
+// restricted networks where raw TCP to arbitrary ports is blocked.
+// Accepted connections are fed into the wrapped Server's existing
+// connection handler.
+type WebSocketServer struct {
+	// Path is the HTTP path the WebSocket upgrade is served on.
+	Path string
+	// Origins, if non-empty, restricts upgrades to these Origin
+	// header values. Empty means any origin is accepted.
+	Origins []string
+	// PingInterval governs how often a ping keepalive is sent.
+	PingInterval time.Duration
+
+	server   *Server
+	upgrader websocket.Upgrader
+}
+
+// NewWebSocketServer wraps server so SOCKS5 sessions arriving over
+// a WebSocket upgrade on path are fed into the same connection
+// handler as plain TCP sessions.
+func NewWebSocketServer(server *Server, path string) *WebSocketServer {
+	ws := &WebSocketServer{Path: path, PingInterval: 30 * time.Second, server: server}
+	ws.upgrader = websocket.Upgrader{
+		Subprotocols: []string{websocketSubprotocol},
+		CheckOrigin:  ws.checkOrigin,
+	}
+	return ws
+}
+
+// ServeHTTP implements http.Handler, upgrading the request to a
+// WebSocket connection and handing the adapted net.Conn to the
+// wrapped Server's connection handler.
+func (ws *WebSocketServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	conn, err := ws.upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		ws.server.logger.Error("websocket upgrade failed", "error", err)
+		return
+	}
+
+	wrapped := newWSConn(conn, ws.PingInterval)
+	wrapped.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	// Mirror ServeTCP's guard: an upgrade can complete concurrently
+	// with Stop/Shutdown, after which startHandler has stopped
+	// receiving, so the send races shutdownCtx instead of happening
+	// unconditionally and blocking forever.
+	select {
+	case ws.server.connectHandler <- wrapped:
+	case <-ws.server.shutdownCtx.Done():
+		wrapped.Close()
+	}
+}
+
+// checkOrigin enforces the configured Origin allow-list.
+func (ws *WebSocketServer) checkOrigin(r *http.Request) bool {
+	if len(ws.Origins) == 0 {
+		return true
+	}
+
+	origin := r.Header.Get("Origin")
+	for _, allowed := range ws.Origins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// ListenAndServe starts an HTTP server on addr serving the
+// WebSocket upgrade on ws.Path.
+func (ws *WebSocketServer) ListenAndServe(addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle(ws.Path, ws)
+	return http.ListenAndServe(addr, mux)
+}
+
+// DialWebSocket connects to a WebSocketServer at urlStr (ws:// or
+// wss://) and returns a net.Conn carrying a SOCKS5 session, for use
+// by clients that need to traverse an HTTP-only middlebox.
+func DialWebSocket(urlStr string) (net.Conn, error) {
+	dialer := websocket.Dialer{Subprotocols: []string{websocketSubprotocol}}
+	conn, _, err := dialer.Dial(urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return newWSConn(conn, 0), nil
+}
+
+// wsConn adapts a *websocket.Conn, which exchanges discrete framed
+// messages, into a net.Conn, which exposes a byte stream, by
+// framing every SOCKS byte stream inside binary WebSocket frames.
+type wsConn struct {
+	conn   *websocket.Conn
+	reader io.Reader
+
+	writeMu sync.Mutex
+}
+
+// newWSConn wraps conn and, if pingInterval is positive, starts a
+// keepalive goroutine that pings the peer on that interval.
+func newWSConn(conn *websocket.Conn, pingInterval time.Duration) *wsConn {
+	wrapped := &wsConn{conn: conn}
+
+	conn.SetPongHandler(func(string) error {
+		return nil
+	})
+
+	if pingInterval > 0 {
+		go wrapped.keepalive(pingInterval)
+	}
+
+	return wrapped
+}
+
+// keepalive sends a ping frame every interval until a write fails,
+// which happens once the underlying connection is closed.
+func (wrapped *wsConn) keepalive(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		wrapped.writeMu.Lock()
+		err := wrapped.conn.WriteMessage(websocket.PingMessage, nil)
+		wrapped.writeMu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Read drains the current WebSocket message into p, fetching the
+// next message once the current one is exhausted.
+func (wrapped *wsConn) Read(p []byte) (int, error) {
+	for {
+		if wrapped.reader == nil {
+			_, reader, err := wrapped.conn.NextReader()
+			if err != nil {
+				return 0, err
+			}
+			wrapped.reader = reader
+		}
+
+		n, err := wrapped.reader.Read(p)
+		if err == io.EOF {
+			wrapped.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Write sends p as a single binary WebSocket message.
+func (wrapped *wsConn) Write(p []byte) (int, error) {
+	wrapped.writeMu.Lock()
+	defer wrapped.writeMu.Unlock()
+
+	if err := wrapped.conn.WriteMessage(websocket.BinaryMessage, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the underlying WebSocket connection.
+func (wrapped *wsConn) Close() error {
+	return wrapped.conn.Close()
+}
+
+// LocalAddr returns the underlying WebSocket connection's local address.
+func (wrapped *wsConn) LocalAddr() net.Addr {
+	return wrapped.conn.LocalAddr()
+}
+
+// RemoteAddr returns the underlying WebSocket connection's remote address.
+func (wrapped *wsConn) RemoteAddr() net.Addr {
+	return wrapped.conn.RemoteAddr()
+}
+
+// SetDeadline sets both the read and write deadlines.
+func (wrapped *wsConn) SetDeadline(t time.Time) error {
+	if err := wrapped.conn.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return wrapped.conn.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline.
+func (wrapped *wsConn) SetReadDeadline(t time.Time) error {
+	return wrapped.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline.
+func (wrapped *wsConn) SetWriteDeadline(t time.Time) error {
+	return wrapped.conn.SetWriteDeadline(t)
+}
@@ -0,0 +1,142 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func wsURL(httpServer *httptest.Server, path string) string {
+	return "ws" + strings.TrimPrefix(httpServer.URL, "http") + path
+}
+
+func TestWebSocketServerRejectsDisallowedOrigin(t *testing.T) {
+	server := New("test", 0, 1, nil)
+	ws := NewWebSocketServer(server, "/tunnel")
+	ws.Origins = []string{"https://allowed.example"}
+
+	httpServer := httptest.NewServer(ws)
+	defer httpServer.Close()
+
+	dialer := websocket.Dialer{Subprotocols: []string{websocketSubprotocol}}
+	_, resp, err := dialer.Dial(wsURL(httpServer, "/tunnel"), http.Header{"Origin": []string{"https://evil.example"}})
+	if err == nil {
+		t.Fatal("expected the upgrade to be rejected for a disallowed Origin")
+	}
+	if resp == nil || resp.StatusCode != http.StatusForbidden {
+		t.Errorf("got response %+v, want status %d", resp, http.StatusForbidden)
+	}
+}
+
+func TestWebSocketServerNegotiatesSOCKS5Subprotocol(t *testing.T) {
+	server := New("test", 0, 1, nil)
+	ws := NewWebSocketServer(server, "/tunnel")
+
+	httpServer := httptest.NewServer(ws)
+	defer httpServer.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() { accepted <- <-server.connectHandler }()
+
+	dialer := websocket.Dialer{Subprotocols: []string{websocketSubprotocol}}
+	_, resp, err := dialer.Dial(wsURL(httpServer, "/tunnel"), nil)
+	if err != nil {
+		t.Fatalf("Dial failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if got := resp.Header.Get("Sec-WebSocket-Protocol"); got != websocketSubprotocol {
+		t.Errorf("negotiated subprotocol = %q, want %q", got, websocketSubprotocol)
+	}
+
+	(<-accepted).Close()
+}
+
+// TestWebSocketServerDoesNotPanicOnUpgradeAfterShutdown covers the
+// same race ServeTCP is guarded against (Stop/Shutdown landing while
+// a connection is mid-handoff): an upgrade that completes after the
+// server has been shut down must not be handed to connectHandler
+// unconditionally, since startHandler no longer receives from it and
+// the send would block forever. Instead the accepted WebSocket
+// connection should simply be closed.
+func TestWebSocketServerDoesNotPanicOnUpgradeAfterShutdown(t *testing.T) {
+	server := New("test", 0, 1, nil)
+	ws := NewWebSocketServer(server, "/tunnel")
+
+	httpServer := httptest.NewServer(ws)
+	defer httpServer.Close()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	server.listener = listener
+	server.closeAccept()
+
+	dialer := websocket.Dialer{Subprotocols: []string{websocketSubprotocol}}
+	conn, _, err := dialer.Dial(wsURL(httpServer, "/tunnel"), nil)
+	if err != nil {
+		// The server closed the connection before/while upgrading --
+		// an acceptable outcome post-shutdown, and not a panic.
+		return
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err = conn.ReadMessage()
+	if err == nil {
+		t.Fatalf("expected the connection to be closed after a post-shutdown upgrade")
+	}
+	if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Fatalf("connection was left open after a post-shutdown upgrade: %v", err)
+	}
+}
+
+func TestWebSocketRoundTripCarriesSOCKS5Bytes(t *testing.T) {
+	server := New("test", 0, 1, nil)
+	ws := NewWebSocketServer(server, "/tunnel")
+
+	httpServer := httptest.NewServer(ws)
+	defer httpServer.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() { accepted <- <-server.connectHandler }()
+
+	client, err := DialWebSocket(wsURL(httpServer, "/tunnel"))
+	if err != nil {
+		t.Fatalf("DialWebSocket failed: %v", err)
+	}
+	defer client.Close()
+
+	serverSide := <-accepted
+	defer serverSide.Close()
+
+	if _, err := client.Write([]byte("hello socks5")); err != nil {
+		t.Fatalf("client Write failed: %v", err)
+	}
+
+	buf := make([]byte, len("hello socks5"))
+	if _, err := io.ReadFull(serverSide, buf); err != nil {
+		t.Fatalf("server Read failed: %v", err)
+	}
+	if string(buf) != "hello socks5" {
+		t.Errorf("got %q, want %q", buf, "hello socks5")
+	}
+
+	if _, err := serverSide.Write([]byte("reply bytes")); err != nil {
+		t.Fatalf("server Write failed: %v", err)
+	}
+	reply := make([]byte, len("reply bytes"))
+	if _, err := io.ReadFull(client, reply); err != nil {
+		t.Fatalf("client Read failed: %v", err)
+	}
+	if string(reply) != "reply bytes" {
+		t.Errorf("got %q, want %q", reply, "reply bytes")
+	}
+}